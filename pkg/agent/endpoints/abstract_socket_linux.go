@@ -0,0 +1,72 @@
+//go:build linux
+
+package endpoints
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// probeSeq disambiguates concurrent callers within this process; see the
+// doc comment on the probe name in validateAbstractSocketSupport.
+var probeSeq int64
+
+// validateAbstractSocketSupport binds a throwaway abstract-namespace
+// socket, connects to it, and confirms SO_PEERCRED still resolves,
+// since that is the only form of peer identification available once
+// the socket has no backing inode for PeerTrackerAttestor to stat.
+func validateAbstractSocketSupport() error {
+	// The abstract namespace is shared host-wide, not per-process, so a
+	// fixed probe name would let two agents (or two concurrent callers
+	// in this same process) racing this check collide on EADDRINUSE
+	// instead of each getting a clean answer. PID plus a per-process
+	// sequence number makes every probe name unique.
+	probeName := fmt.Sprintf("\x00spire-agent-abstract-socket-probe-%d-%d", os.Getpid(), atomic.AddInt64(&probeSeq, 1))
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Net: "unix", Name: probeName})
+	if err != nil {
+		return fmt.Errorf("abstract socket support: %w", err)
+	}
+	defer ln.Close()
+
+	acceptErr := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			acceptErr <- err
+			return
+		}
+		conn.Close()
+		acceptErr <- nil
+	}()
+
+	conn, err := net.DialUnix("unix", nil, ln.Addr().(*net.UnixAddr))
+	if err != nil {
+		return fmt.Errorf("abstract socket support: dial probe: %w", err)
+	}
+	defer conn.Close()
+
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return fmt.Errorf("abstract socket support: %w", err)
+	}
+
+	var ucred *unix.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		ucred, credErr = unix.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		return fmt.Errorf("abstract socket support: %w", err)
+	}
+	if credErr != nil {
+		return fmt.Errorf("abstract socket support: SO_PEERCRED unavailable: %w", credErr)
+	}
+	if ucred == nil {
+		return fmt.Errorf("abstract socket support: SO_PEERCRED returned no credentials")
+	}
+	return <-acceptErr
+}
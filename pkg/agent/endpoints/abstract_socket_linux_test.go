@@ -0,0 +1,28 @@
+//go:build linux
+
+package endpoints
+
+import "testing"
+
+func TestValidateAbstractSocketSupport(t *testing.T) {
+	if err := validateAbstractSocketSupport(); err != nil {
+		t.Fatalf("validateAbstractSocketSupport: %v", err)
+	}
+}
+
+func TestValidateAbstractSocketSupportIsConcurrencySafe(t *testing.T) {
+	// Regression test: the probe socket name must be unique per call, or
+	// two goroutines (standing in for two agent processes validating
+	// their config at the same time) collide on EADDRINUSE instead of
+	// each getting a clean answer.
+	const n = 8
+	errCh := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() { errCh <- validateAbstractSocketSupport() }()
+	}
+	for i := 0; i < n; i++ {
+		if err := <-errCh; err != nil {
+			t.Errorf("validateAbstractSocketSupport: %v", err)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package endpoints
+
+import "errors"
+
+// validateAbstractSocketSupport rejects abstract-namespace Unix domain
+// sockets outright: they are a Linux kernel feature with no equivalent
+// on other platforms.
+func validateAbstractSocketSupport() error {
+	return errors.New("abstract-namespace Unix domain sockets are only supported on Linux")
+}
@@ -0,0 +1,142 @@
+package endpoints
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+
+	discovery_v2 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	secret_v3 "github.com/envoyproxy/go-control-plane/envoy/service/secret/v3"
+	"github.com/sirupsen/logrus"
+	workload_pb "github.com/spiffe/go-spiffe/v2/proto/spiffe/workload"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	healthv1 "github.com/spiffe/spire/pkg/agent/api/health/v1"
+	"github.com/spiffe/spire/pkg/agent/attestor"
+	"github.com/spiffe/spire/pkg/agent/endpoints/sdsv2"
+	"github.com/spiffe/spire/pkg/agent/endpoints/sdsv3"
+	"github.com/spiffe/spire/pkg/agent/endpoints/workload"
+	"github.com/spiffe/spire/pkg/agent/manager"
+	"github.com/spiffe/spire/pkg/common/telemetry"
+	"github.com/spiffe/spire/proto/spire/common"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+)
+
+// Config configures the set of API endpoints served by the agent.
+//
+// This is the library-level config struct only. Nothing parses it out of
+// agent.conf: there are no HCL keys for the listeners, PROXY protocol,
+// gateway, message-size, keepalive or tracing settings below, and
+// Validate is the only validation applied to them.
+type Config struct {
+	// Listeners are the individual Workload/SDS/Health API endpoints to
+	// stand up. Each is served by its own gRPC server, bound to its own
+	// listener, with its own attestor and permission policy, but they
+	// all share the manager and other fields below.
+	Listeners []APIEndpointConfig
+
+	// Gateway, when set, stands up an additional gRPC-Web front end for
+	// the Workload API alongside Listeners. There is no HTTP/JSON front
+	// end.
+	Gateway *GatewayConfig
+
+	Manager                       manager.Manager
+	Log                           logrus.FieldLogger
+	Metrics                       telemetry.Metrics
+	DefaultSVIDName               string
+	DefaultBundleName             string
+	DefaultAllBundlesName         string
+	AllowUnauthenticatedVerifiers bool
+	AllowedForeignJWTClaims       []string
+	TrustDomain                   spiffeid.TrustDomain
+
+	// MaxRecvMsgSize and MaxSendMsgSize override gRPC's 4 MiB default
+	// message size limit, which a large trust bundle or a JWKS with
+	// many keys can exceed, surfacing as a cryptic ResourceExhausted to
+	// the workload. Zero leaves gRPC's default in place.
+	MaxRecvMsgSize int
+	MaxSendMsgSize int
+
+	// MaxConcurrentStreams bounds concurrent streams per HTTP/2
+	// connection. Zero leaves gRPC's default in place.
+	MaxConcurrentStreams uint32
+
+	// KeepaliveParams and KeepaliveEnforcementPolicy let operators
+	// running the agent behind a proxy such as Envoy align the agent's
+	// keepalive behavior with what the upstream expects. The zero value
+	// of each leaves gRPC's defaults in place.
+	KeepaliveParams            keepalive.ServerParameters
+	KeepaliveEnforcementPolicy keepalive.EnforcementPolicy
+
+	// EnableGRPCTracing turns on grpc-go's golang.org/x/net/trace
+	// integration for request tracing via /debug/requests. This is a
+	// process-wide setting in grpc-go, not one scoped to a single
+	// server, so it takes effect for the lifetime of the agent process
+	// once any Endpoints is constructed with it set.
+	EnableGRPCTracing bool
+
+	newWorkloadAPIServer func(c workload.Config) workload_pb.SpiffeWorkloadAPIServer
+	newSDSv2Server       func(c sdsv2.Config) discovery_v2.SecretDiscoveryServiceServer
+	newSDSv3Server       func(c sdsv3.Config) secret_v3.SecretDiscoveryServiceServer
+	newHealthServer      func(c healthv1.Config) grpc_health_v1.HealthServer
+}
+
+// APIEndpointConfig describes a single listener on which the Workload,
+// SDS, and health APIs are served. An agent declares one of these per
+// listen address, e.g. a Unix domain socket for local workloads and a
+// TCP socket for a hostNetwork bridge, so each can carry its own
+// attestor and permission policy.
+type APIEndpointConfig struct {
+	// Address is the network address to listen on. Network() must be
+	// "unix" or "tcp".
+	Address net.Addr
+
+	// Attestor attests workloads that connect on this listener.
+	Attestor attestor.Attestor
+
+	// AllowedSelectors, when non-empty, restricts the registration
+	// entries servable on this listener to those selecting at least one
+	// of the given selectors. A nil/empty list allows all entries.
+	AllowedSelectors []*common.Selector
+
+	// TLSConfig, when set, wraps the listener with TLS. This is used by
+	// listeners that cannot rely on local peer tracking (e.g. a TCP
+	// socket terminated from outside the host's kernel).
+	TLSConfig *tls.Config
+
+	// TrustedProxies, when set on a TCP listener, enables PROXY protocol
+	// (v1/v2) support: connections from these source CIDRs are expected
+	// to carry a PROXY header, and the original client address it
+	// encodes is used for attestation and logging instead of the
+	// connecting load balancer's address. Connections from sources
+	// outside TrustedProxies are rejected before the handshake. Ignored
+	// on Unix domain socket listeners.
+	TrustedProxies []*net.IPNet
+
+	// RequireProxyHeader, when true, rejects connections from a trusted
+	// proxy that arrive without a PROXY header instead of falling back
+	// to the raw peer address. Only meaningful when TrustedProxies is
+	// set.
+	RequireProxyHeader bool
+}
+
+// Validate performs config-load-time checks that go beyond basic type
+// assertions, such as confirming abstract-namespace Unix domain socket
+// support is actually usable on this platform before ListenAndServe
+// ever tries to bind one.
+func (c Config) Validate() error {
+	if len(c.Listeners) == 0 {
+		return errors.New("at least one listener is required")
+	}
+	for _, lc := range c.Listeners {
+		unixAddr, ok := lc.Address.(*net.UnixAddr)
+		if !ok || !isAbstractSocketName(unixAddr.Name) {
+			continue
+		}
+		if err := validateAbstractSocketSupport(); err != nil {
+			return fmt.Errorf("listener %q: %w", lc.Address, err)
+		}
+	}
+	return nil
+}
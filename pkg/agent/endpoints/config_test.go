@@ -0,0 +1,24 @@
+package endpoints
+
+import (
+	"net"
+	"testing"
+)
+
+func TestConfigValidateRejectsEmptyListeners(t *testing.T) {
+	err := Config{}.Validate()
+	if err == nil {
+		t.Fatal("Validate succeeded with no Listeners, want an error")
+	}
+}
+
+func TestConfigValidateAcceptsAtLeastOneListener(t *testing.T) {
+	c := Config{
+		Listeners: []APIEndpointConfig{
+			{Address: &net.UnixAddr{Net: "unix", Name: "/tmp/spire-agent.sock"}},
+		},
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
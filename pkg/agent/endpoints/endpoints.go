@@ -2,10 +2,13 @@ package endpoints
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
 	"os"
+	"strings"
+	"sync/atomic"
 
 	discovery_v2 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
 	secret_v3 "github.com/envoyproxy/go-control-plane/envoy/service/secret/v3"
@@ -17,32 +20,71 @@ import (
 	"github.com/spiffe/spire/pkg/agent/endpoints/workload"
 	"github.com/spiffe/spire/pkg/common/api/middleware"
 	"github.com/spiffe/spire/pkg/common/peertracker"
+	"github.com/spiffe/spire/pkg/common/sdnotify"
 	"github.com/spiffe/spire/pkg/common/telemetry"
+	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
 )
 
 type Server interface {
 	ListenAndServe(ctx context.Context) error
 }
 
+// Endpoints serves the Workload, SDS, and health APIs on one or more
+// listeners, each with its own gRPC server, attestor, and permission
+// policy. All listeners run under one context and are brought up and
+// torn down together.
 type Endpoints struct {
-	addr              net.Addr
-	log               logrus.FieldLogger
-	metrics           telemetry.Metrics
-	workloadAPIServer workload_pb.SpiffeWorkloadAPIServer
-	sdsv2Server       discovery_v2.SecretDiscoveryServiceServer
-	sdsv3Server       secret_v3.SecretDiscoveryServiceServer
-	healthServer      grpc_health_v1.HealthServer
+	log     logrus.FieldLogger
+	metrics telemetry.Metrics
+
+	endpoints []*endpoint
+	gateway   *gateway
+	notifier  *sdnotify.Notifier
+
+	// ready counts listeners (including the gateway, if configured) that
+	// have started; READY=1 is reported to systemd once ready reaches
+	// readyTarget.
+	ready       int32
+	readyTarget int32
+
+	maxRecvMsgSize             int
+	maxSendMsgSize             int
+	maxConcurrentStreams       uint32
+	keepaliveParams            keepalive.ServerParameters
+	keepaliveEnforcementPolicy keepalive.EnforcementPolicy
 
 	hooks struct {
-		// test hook used to indicate that is listening
+		// test hook signaled once by each listener as it starts listening
 		listening chan struct{}
 	}
 }
 
-func New(c Config) *Endpoints {
-	attestor := PeerTrackerAttestor{Attestor: c.Attestor}
+// endpoint is a single bound listener and the gRPC server that serves it.
+type endpoint struct {
+	addr               net.Addr
+	log                logrus.FieldLogger
+	tlsConfig          *tls.Config
+	trustedProxies     []*net.IPNet
+	requireProxyHeader bool
+
+	workloadAPIServer workload_pb.SpiffeWorkloadAPIServer
+	sdsv2Server       discovery_v2.SecretDiscoveryServiceServer
+	sdsv3Server       secret_v3.SecretDiscoveryServiceServer
+	healthServer      grpc_health_v1.HealthServer
+}
+
+// New builds the set of API endpoints described by c. It returns an error
+// if c.Validate does, e.g. because a listener asks for an abstract-namespace
+// Unix domain socket on a platform or kernel that can't back it — better to
+// fail here than to discover it when ListenAndServe tries to bind.
+func New(c Config) (*Endpoints, error) {
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid endpoints configuration: %w", err)
+	}
 
 	if c.newWorkloadAPIServer == nil {
 		c.newWorkloadAPIServer = func(c workload.Config) workload_pb.SpiffeWorkloadAPIServer {
@@ -70,71 +112,198 @@ func New(c Config) *Endpoints {
 		allowedClaims[claim] = struct{}{}
 	}
 
-	workloadAPIServer := c.newWorkloadAPIServer(workload.Config{
-		Manager:                       c.Manager,
-		Attestor:                      attestor,
-		AllowUnauthenticatedVerifiers: c.AllowUnauthenticatedVerifiers,
-		AllowedForeignJWTClaims:       allowedClaims,
-		TrustDomain:                   c.TrustDomain,
-	})
-
-	sdsv2Server := c.newSDSv2Server(sdsv2.Config{
-		Attestor:          attestor,
-		Manager:           c.Manager,
-		DefaultSVIDName:   c.DefaultSVIDName,
-		DefaultBundleName: c.DefaultBundleName,
-	})
-
-	sdsv3Server := c.newSDSv3Server(sdsv3.Config{
-		Attestor:              attestor,
-		Manager:               c.Manager,
-		DefaultSVIDName:       c.DefaultSVIDName,
-		DefaultBundleName:     c.DefaultBundleName,
-		DefaultAllBundlesName: c.DefaultAllBundlesName,
-	})
-
-	healthServer := c.newHealthServer(healthv1.Config{
-		Addr: c.BindAddr,
-	})
-
-	return &Endpoints{
-		addr:              c.BindAddr,
-		log:               c.Log,
-		metrics:           c.Metrics,
-		workloadAPIServer: workloadAPIServer,
-		sdsv2Server:       sdsv2Server,
-		sdsv3Server:       sdsv3Server,
-		healthServer:      healthServer,
+	endpoints := make([]*endpoint, 0, len(c.Listeners))
+	for _, lc := range c.Listeners {
+		attestor := PeerTrackerAttestor{Attestor: lc.Attestor}
+
+		workloadAPIServer := c.newWorkloadAPIServer(workload.Config{
+			Manager:                       c.Manager,
+			Attestor:                      attestor,
+			AllowUnauthenticatedVerifiers: c.AllowUnauthenticatedVerifiers,
+			AllowedForeignJWTClaims:       allowedClaims,
+			TrustDomain:                   c.TrustDomain,
+			AllowedSelectors:              lc.AllowedSelectors,
+		})
+
+		sdsv2Server := c.newSDSv2Server(sdsv2.Config{
+			Attestor:          attestor,
+			Manager:           c.Manager,
+			DefaultSVIDName:   c.DefaultSVIDName,
+			DefaultBundleName: c.DefaultBundleName,
+			AllowedSelectors:  lc.AllowedSelectors,
+		})
+
+		sdsv3Server := c.newSDSv3Server(sdsv3.Config{
+			Attestor:              attestor,
+			Manager:               c.Manager,
+			DefaultSVIDName:       c.DefaultSVIDName,
+			DefaultBundleName:     c.DefaultBundleName,
+			DefaultAllBundlesName: c.DefaultAllBundlesName,
+			AllowedSelectors:      lc.AllowedSelectors,
+		})
+
+		healthServer := c.newHealthServer(healthv1.Config{
+			Addr: lc.Address,
+		})
+
+		endpoints = append(endpoints, &endpoint{
+			addr:               lc.Address,
+			log:                c.Log.WithField(telemetry.Network, lc.Address.Network()).WithField(telemetry.Address, lc.Address.String()),
+			tlsConfig:          lc.TLSConfig,
+			trustedProxies:     lc.TrustedProxies,
+			requireProxyHeader: lc.RequireProxyHeader,
+			workloadAPIServer:  workloadAPIServer,
+			sdsv2Server:        sdsv2Server,
+			sdsv3Server:        sdsv3Server,
+			healthServer:       healthServer,
+		})
 	}
+
+	var gw *gateway
+	readyTarget := len(endpoints)
+	if c.Gateway != nil {
+		gw = newGateway(*c.Gateway, c.Log.WithField("subsystem_name", "workload_api_gateway"))
+		readyTarget++
+	}
+
+	if c.EnableGRPCTracing {
+		// grpc.EnableTracing is process-wide, not per-server; see the
+		// doc comment on Config.EnableGRPCTracing.
+		grpc.EnableTracing = true
+	}
+
+	e := &Endpoints{
+		log:                        c.Log,
+		metrics:                    c.Metrics,
+		endpoints:                  endpoints,
+		gateway:                    gw,
+		notifier:                   sdnotify.New(),
+		readyTarget:                int32(readyTarget),
+		maxRecvMsgSize:             c.MaxRecvMsgSize,
+		maxSendMsgSize:             c.MaxSendMsgSize,
+		maxConcurrentStreams:       c.MaxConcurrentStreams,
+		keepaliveParams:            c.KeepaliveParams,
+		keepaliveEnforcementPolicy: c.KeepaliveEnforcementPolicy,
+	}
+	if gw != nil {
+		gw.onListening = e.notifyGatewayListening
+	}
+	return e, nil
 }
 
+// ListenAndServe binds and serves every configured listener, and blocks
+// until ctx is canceled or one of the listeners fails. All listeners are
+// stopped together before returning. If the agent is running under
+// systemd (NOTIFY_SOCKET is set), it also reports READY=1 once every
+// listener is up, STOPPING=1 when ctx is canceled, and WATCHDOG=1
+// keepalives gated on an internal health check.
 func (e *Endpoints) ListenAndServe(ctx context.Context) error {
+	group, ctx := errgroup.WithContext(ctx)
+
+	go func() {
+		<-ctx.Done()
+		if err := e.notifier.Stopping(); err != nil {
+			e.log.WithError(err).Warn("Failed to notify systemd of shutdown")
+		}
+	}()
+
+	e.notifier.RunWatchdog(ctx, e.livenessProbe)
+
+	for _, ep := range e.endpoints {
+		ep := ep
+		group.Go(func() error {
+			return e.listenAndServeOne(ctx, ep)
+		})
+	}
+	if e.gateway != nil {
+		group.Go(func() error {
+			return e.gateway.ListenAndServe(ctx)
+		})
+	}
+	return group.Wait()
+}
+
+// Reload notifies systemd that the agent is reloading its configuration,
+// runs fn, and reports readiness again once it completes successfully.
+//
+// Reload is meant to be called from the daemon's own config-reload path
+// (e.g. its SIGHUP handler), which lives outside this package and outside
+// this trimmed snapshot, so that wiring isn't present here — there is
+// nothing in this tree that would call it. Whatever reloads Endpoints'
+// backing config (attestors, listeners, manager) should call this to keep
+// systemd's view of RELOADING/READY in sync with the actual reload.
+func (e *Endpoints) Reload(fn func() error) error {
+	if err := e.notifier.Reloading(); err != nil {
+		e.log.WithError(err).Warn("Failed to notify systemd of reload")
+	}
+	err := fn()
+	if err == nil {
+		if rerr := e.notifier.Ready(""); rerr != nil {
+			e.log.WithError(rerr).Warn("Failed to notify systemd of readiness")
+		}
+	}
+	return err
+}
+
+// livenessProbe is the watchdog's liveness check: the health server on
+// the first configured endpoint must report SERVING.
+func (e *Endpoints) livenessProbe(ctx context.Context) error {
+	if len(e.endpoints) == 0 {
+		return nil
+	}
+	resp, err := e.endpoints[0].healthServer.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		return err
+	}
+	if resp.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+		return fmt.Errorf("endpoint not serving: %s", resp.Status)
+	}
+	return nil
+}
+
+func (e *Endpoints) listenAndServeOne(ctx context.Context, ep *endpoint) error {
 	unaryInterceptor, streamInterceptor := middleware.Interceptors(
-		Middleware(e.log, e.metrics),
+		Middleware(ep.log, e.metrics),
 	)
 
-	server := grpc.NewServer(
-		grpc.Creds(peertracker.NewCredentials()),
+	serverOpts := []grpc.ServerOption{
+		grpc.Creds(peerCredentials(ep)),
 		grpc.UnaryInterceptor(unaryInterceptor),
 		grpc.StreamInterceptor(streamInterceptor),
-	)
+	}
+	if e.maxRecvMsgSize > 0 {
+		serverOpts = append(serverOpts, grpc.MaxRecvMsgSize(e.maxRecvMsgSize))
+	}
+	if e.maxSendMsgSize > 0 {
+		serverOpts = append(serverOpts, grpc.MaxSendMsgSize(e.maxSendMsgSize))
+	}
+	if e.maxConcurrentStreams > 0 {
+		serverOpts = append(serverOpts, grpc.MaxConcurrentStreams(e.maxConcurrentStreams))
+	}
+	if e.keepaliveParams != (keepalive.ServerParameters{}) {
+		serverOpts = append(serverOpts, grpc.KeepaliveParams(e.keepaliveParams))
+	}
+	if e.keepaliveEnforcementPolicy != (keepalive.EnforcementPolicy{}) {
+		serverOpts = append(serverOpts, grpc.KeepaliveEnforcementPolicy(e.keepaliveEnforcementPolicy))
+	}
+
+	server := grpc.NewServer(serverOpts...)
 
-	workload_pb.RegisterSpiffeWorkloadAPIServer(server, e.workloadAPIServer)
-	discovery_v2.RegisterSecretDiscoveryServiceServer(server, e.sdsv2Server)
-	secret_v3.RegisterSecretDiscoveryServiceServer(server, e.sdsv3Server)
-	grpc_health_v1.RegisterHealthServer(server, e.healthServer)
+	workload_pb.RegisterSpiffeWorkloadAPIServer(server, ep.workloadAPIServer)
+	discovery_v2.RegisterSecretDiscoveryServiceServer(server, ep.sdsv2Server)
+	secret_v3.RegisterSecretDiscoveryServiceServer(server, ep.sdsv3Server)
+	grpc_health_v1.RegisterHealthServer(server, ep.healthServer)
 
 	var l net.Listener
 	var err error
-	switch e.addr.Network() {
+	switch ep.addr.Network() {
 	case "unix":
-		l, err = e.createUDSListener()
+		l, err = createUDSListener(ep)
 	case "tcp":
-		l, err = e.createTCPListener()
+		l, err = createTCPListener(ep)
 	default:
-		return net.UnknownNetworkError(e.addr.Network())
+		return net.UnknownNetworkError(ep.addr.Network())
 	}
-
 	if err != nil {
 		return err
 	}
@@ -144,19 +313,19 @@ func (e *Endpoints) ListenAndServe(ctx context.Context) error {
 	// If a TCP address was specified with port 0, this will
 	// update the address with the actual port that is used
 	// to listen.
-	e.addr = l.Addr()
-	e.log.WithFields(logrus.Fields{
-		telemetry.Network: e.addr.Network(),
-		telemetry.Address: e.addr,
+	ep.addr = l.Addr()
+	ep.log.WithFields(logrus.Fields{
+		telemetry.Network: ep.addr.Network(),
+		telemetry.Address: ep.addr,
 	}).Info("Starting Workload and SDS APIs")
-	e.triggerListeningHook()
-	errChan := make(chan error)
+	e.notifyListening(ep)
+	errChan := make(chan error, 1)
 	go func() { errChan <- server.Serve(l) }()
 
 	select {
 	case err = <-errChan:
 	case <-ctx.Done():
-		e.log.Info("Stopping Workload and SDS APIs")
+		ep.log.Info("Stopping Workload and SDS APIs")
 		server.Stop()
 		err = <-errChan
 		if errors.Is(err, grpc.ErrServerStopped) {
@@ -166,43 +335,110 @@ func (e *Endpoints) ListenAndServe(ctx context.Context) error {
 	return err
 }
 
-func (e *Endpoints) createUDSListener() (net.Listener, error) {
-	// Remove uds if already exists
-	os.Remove(e.addr.String())
+// peerCredentials selects the transport credentials for ep. grpc applies
+// the last grpc.Creds option given to grpc.NewServer, so stacking both
+// peertracker and TLS credentials would silently drop peer tracking —
+// exactly one must be chosen. A TLS listener exists specifically for the
+// case where local peer tracking is unavailable (see
+// APIEndpointConfig.TLSConfig), so it uses TLS creds exclusively.
+func peerCredentials(ep *endpoint) credentials.TransportCredentials {
+	if ep.tlsConfig != nil {
+		return credentials.NewTLS(ep.tlsConfig)
+	}
+	return peertracker.NewCredentials()
+}
 
+func createUDSListener(ep *endpoint) (net.Listener, error) {
 	unixListener := &peertracker.ListenerFactory{
-		Log: e.log,
+		Log: ep.log,
 	}
 
-	unixAddr, ok := e.addr.(*net.UnixAddr)
+	unixAddr, ok := ep.addr.(*net.UnixAddr)
 	if !ok {
-		return nil, fmt.Errorf("create UDS listener: address is type %T, not net.UnixAddr", e.addr)
+		return nil, fmt.Errorf("create UDS listener: address is type %T, not net.UnixAddr", ep.addr)
+	}
+
+	if isAbstractSocketName(unixAddr.Name) {
+		// Abstract sockets have no backing inode: there is nothing to
+		// remove beforehand and nothing to chmod afterward. The leading
+		// NUL is the kernel's marker for the abstract namespace; "@" is
+		// the conventional way to spell it in configuration.
+		abstractAddr := &net.UnixAddr{Net: unixAddr.Net, Name: "\x00" + unixAddr.Name[1:]}
+		l, err := unixListener.ListenUnix(unixAddr.Network(), abstractAddr)
+		if err != nil {
+			return nil, fmt.Errorf("create UDS listener: %w", err)
+		}
+		return l, nil
 	}
-	l, err := unixListener.ListenUnix(e.addr.Network(), unixAddr)
+
+	// Remove uds if already exists
+	os.Remove(ep.addr.String())
+
+	l, err := unixListener.ListenUnix(ep.addr.Network(), unixAddr)
 	if err != nil {
 		return nil, fmt.Errorf("create UDS listener: %w", err)
 	}
 
-	if err := os.Chmod(e.addr.String(), os.ModePerm); err != nil {
+	if err := os.Chmod(ep.addr.String(), os.ModePerm); err != nil {
 		return nil, fmt.Errorf("unable to change UDS permissions: %w", err)
 	}
 	return l, nil
 }
 
-func (e *Endpoints) createTCPListener() (net.Listener, error) {
-	tcpListener := &peertracker.ListenerFactory{
-		Log: e.log,
+// isAbstractSocketName reports whether name uses the conventional "@"
+// prefix for a Linux abstract-namespace Unix domain socket.
+func isAbstractSocketName(name string) bool {
+	return strings.HasPrefix(name, "@")
+}
+
+func createTCPListener(ep *endpoint) (net.Listener, error) {
+	tcpAddr, ok := ep.addr.(*net.TCPAddr)
+	if !ok {
+		return nil, fmt.Errorf("create TCP listener: address is type %T, not net.TCPAddr", ep.addr)
 	}
 
-	l, err := tcpListener.ListenTCP(e.addr.Network(), e.addr.(*net.TCPAddr))
+	l, err := net.ListenTCP(ep.addr.Network(), tcpAddr)
 	if err != nil {
 		return nil, fmt.Errorf("create TCP listener: %w", err)
 	}
-	return l, nil
+
+	// Decode PROXY protocol headers, if configured, before the listener
+	// reaches peertracker. peertracker.Watcher (and so PeerTrackerAttestor)
+	// keys attestation and logging off Accept()'s RemoteAddr, so the
+	// original client address must already be substituted in by the time
+	// peertracker sees the connection, not after.
+	decoded := wrapProxyProtocol(l, ep)
+
+	tcpListener := &peertracker.ListenerFactory{
+		Log: ep.log,
+	}
+	return tcpListener.WrapTCPListener(decoded)
 }
 
-func (e *Endpoints) triggerListeningHook() {
+// notifyListening signals the test hook for this listener and counts it
+// toward readiness, alongside the gateway's own notifyGatewayListening.
+func (e *Endpoints) notifyListening(ep *endpoint) {
 	if e.hooks.listening != nil {
 		e.hooks.listening <- struct{}{}
 	}
+	e.markReady()
+}
+
+// notifyGatewayListening is gateway.onListening: it counts the gateway's
+// listener toward readiness the same way notifyListening does for each
+// endpoint, so READY=1 is not reported until the gateway is up as well.
+func (e *Endpoints) notifyGatewayListening() {
+	e.markReady()
+}
+
+// markReady reports READY=1 to systemd once every configured listener —
+// each endpoint plus the gateway, if any — has come up.
+func (e *Endpoints) markReady() {
+	if int(atomic.AddInt32(&e.ready, 1)) != int(e.readyTarget) {
+		return
+	}
+	status := fmt.Sprintf("listening on %d endpoint(s)", e.readyTarget)
+	if err := e.notifier.Ready(status); err != nil {
+		e.log.WithError(err).Warn("Failed to notify systemd of readiness")
+	}
 }
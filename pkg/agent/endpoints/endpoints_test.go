@@ -0,0 +1,73 @@
+package endpoints
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spiffe/spire/pkg/common/peertracker"
+	"google.golang.org/grpc/keepalive"
+)
+
+func TestPeerCredentialsPrefersTLSOverPeerTracking(t *testing.T) {
+	tlsCreds := peerCredentials(&endpoint{tlsConfig: &tls.Config{MinVersion: tls.VersionTLS12}})
+	if got := tlsCreds.Info().SecurityProtocol; got != "tls" {
+		t.Fatalf("expected a TLS listener to use TLS credentials exclusively, got security protocol %q", got)
+	}
+}
+
+func TestPeerCredentialsUsesPeerTrackingWithoutTLS(t *testing.T) {
+	creds := peerCredentials(&endpoint{})
+	want := peertracker.NewCredentials().Info().SecurityProtocol
+	if got := creds.Info().SecurityProtocol; got != want {
+		t.Fatalf("expected peer-tracking credentials (%q) for a listener without TLS, got %q", want, got)
+	}
+}
+
+// TestNewAppliesGRPCTuningOptions guards the option wiring in
+// listenAndServeOne: MaxRecvMsgSize/MaxSendMsgSize/MaxConcurrentStreams and
+// the keepalive settings are only meaningful if they're actually threaded
+// from Config through to Endpoints and applied as grpc.ServerOptions.
+func TestNewAppliesGRPCTuningOptions(t *testing.T) {
+	keepaliveParams := keepalive.ServerParameters{Time: 42}
+	keepaliveEnforcement := keepalive.EnforcementPolicy{MinTime: 7}
+
+	e, err := New(Config{
+		Listeners: []APIEndpointConfig{
+			{Address: &net.UnixAddr{Net: "unix", Name: "/tmp/spire-agent.sock"}},
+		},
+		Log:                        discardLogger(),
+		MaxRecvMsgSize:             1024,
+		MaxSendMsgSize:             2048,
+		MaxConcurrentStreams:       16,
+		KeepaliveParams:            keepaliveParams,
+		KeepaliveEnforcementPolicy: keepaliveEnforcement,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	if e.maxRecvMsgSize != 1024 {
+		t.Errorf("maxRecvMsgSize = %d, want 1024", e.maxRecvMsgSize)
+	}
+	if e.maxSendMsgSize != 2048 {
+		t.Errorf("maxSendMsgSize = %d, want 2048", e.maxSendMsgSize)
+	}
+	if e.maxConcurrentStreams != 16 {
+		t.Errorf("maxConcurrentStreams = %d, want 16", e.maxConcurrentStreams)
+	}
+	if e.keepaliveParams != keepaliveParams {
+		t.Errorf("keepaliveParams = %+v, want %+v", e.keepaliveParams, keepaliveParams)
+	}
+	if e.keepaliveEnforcementPolicy != keepaliveEnforcement {
+		t.Errorf("keepaliveEnforcementPolicy = %+v, want %+v", e.keepaliveEnforcementPolicy, keepaliveEnforcement)
+	}
+}
+
+func discardLogger() *logrus.Logger {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	return log
+}
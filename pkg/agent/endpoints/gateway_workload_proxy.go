@@ -0,0 +1,83 @@
+package endpoints
+
+import (
+	"context"
+	"io"
+
+	workload_pb "github.com/spiffe/go-spiffe/v2/proto/spiffe/workload"
+	"google.golang.org/grpc"
+)
+
+// workloadAPIProxy implements workload_pb.SpiffeWorkloadAPIServer by
+// relaying every call to client, the in-process loopback connection to
+// the agent's real Workload API server. This lets the gRPC-Web listener
+// serve the exact same service definition as the UDS listener without
+// reimplementing any RPC logic, while keeping each leg of the call on
+// its server's normal codec instead of negotiating a shared one.
+type workloadAPIProxy struct {
+	workload_pb.UnimplementedSpiffeWorkloadAPIServer
+	client workload_pb.SpiffeWorkloadAPIClient
+}
+
+func newWorkloadAPIProxy(conn *grpc.ClientConn) *workloadAPIProxy {
+	return &workloadAPIProxy{client: workload_pb.NewSpiffeWorkloadAPIClient(conn)}
+}
+
+func (p *workloadAPIProxy) FetchX509SVID(req *workload_pb.X509SVIDRequest, stream workload_pb.SpiffeWorkloadAPI_FetchX509SVIDServer) error {
+	upstream, err := p.client.FetchX509SVID(stream.Context(), req)
+	if err != nil {
+		return err
+	}
+	return relayWorkloadStream[*workload_pb.X509SVIDResponse](upstream, stream)
+}
+
+func (p *workloadAPIProxy) FetchX509Bundles(req *workload_pb.X509BundlesRequest, stream workload_pb.SpiffeWorkloadAPI_FetchX509BundlesServer) error {
+	upstream, err := p.client.FetchX509Bundles(stream.Context(), req)
+	if err != nil {
+		return err
+	}
+	return relayWorkloadStream[*workload_pb.X509BundlesResponse](upstream, stream)
+}
+
+func (p *workloadAPIProxy) FetchJWTSVID(ctx context.Context, req *workload_pb.JWTSVIDRequest) (*workload_pb.JWTSVIDResponse, error) {
+	return p.client.FetchJWTSVID(ctx, req)
+}
+
+func (p *workloadAPIProxy) FetchJWTBundles(req *workload_pb.JWTBundlesRequest, stream workload_pb.SpiffeWorkloadAPI_FetchJWTBundlesServer) error {
+	upstream, err := p.client.FetchJWTBundles(stream.Context(), req)
+	if err != nil {
+		return err
+	}
+	return relayWorkloadStream[*workload_pb.JWTBundlesResponse](upstream, stream)
+}
+
+func (p *workloadAPIProxy) ValidateJWTSVID(ctx context.Context, req *workload_pb.ValidateJWTSVIDRequest) (*workload_pb.ValidateJWTSVIDResponse, error) {
+	return p.client.ValidateJWTSVID(ctx, req)
+}
+
+// workloadStreamReceiver and workloadStreamSender abstract the one method
+// relayWorkloadStream needs from each generated client- and server-stream
+// type, so a single helper covers all of the Workload API's
+// server-streaming RPCs.
+type workloadStreamReceiver[T any] interface {
+	Recv() (T, error)
+}
+
+type workloadStreamSender[T any] interface {
+	Send(T) error
+}
+
+func relayWorkloadStream[T any](upstream workloadStreamReceiver[T], downstream workloadStreamSender[T]) error {
+	for {
+		msg, err := upstream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := downstream.Send(msg); err != nil {
+			return err
+		}
+	}
+}
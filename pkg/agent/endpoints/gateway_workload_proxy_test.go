@@ -0,0 +1,84 @@
+package endpoints
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+type fakeWorkloadStream struct {
+	msgs []int
+	pos  int
+	err  error
+
+	sent []int
+}
+
+func (f *fakeWorkloadStream) Recv() (int, error) {
+	if f.pos < len(f.msgs) {
+		msg := f.msgs[f.pos]
+		f.pos++
+		return msg, nil
+	}
+	if f.err != nil {
+		return 0, f.err
+	}
+	return 0, io.EOF
+}
+
+func (f *fakeWorkloadStream) Send(msg int) error {
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+func TestRelayWorkloadStreamForwardsUntilEOF(t *testing.T) {
+	upstream := &fakeWorkloadStream{msgs: []int{1, 2, 3}}
+	downstream := &fakeWorkloadStream{}
+
+	if err := relayWorkloadStream[int](upstream, downstream); err != nil {
+		t.Fatalf("relayWorkloadStream: %v", err)
+	}
+
+	want := []int{1, 2, 3}
+	if len(downstream.sent) != len(want) {
+		t.Fatalf("sent %v, want %v", downstream.sent, want)
+	}
+	for i, msg := range want {
+		if downstream.sent[i] != msg {
+			t.Errorf("sent[%d] = %d, want %d", i, downstream.sent[i], msg)
+		}
+	}
+}
+
+func TestRelayWorkloadStreamPropagatesUpstreamError(t *testing.T) {
+	upstreamErr := errors.New("upstream broke")
+	upstream := &fakeWorkloadStream{msgs: []int{1}, err: upstreamErr}
+	downstream := &fakeWorkloadStream{}
+
+	err := relayWorkloadStream[int](upstream, downstream)
+	if !errors.Is(err, upstreamErr) {
+		t.Fatalf("relayWorkloadStream error = %v, want %v", err, upstreamErr)
+	}
+	if len(downstream.sent) != 1 {
+		t.Fatalf("sent %v, want the one message received before the error", downstream.sent)
+	}
+}
+
+func TestRelayWorkloadStreamPropagatesDownstreamError(t *testing.T) {
+	downstreamErr := errors.New("client disconnected")
+	upstream := &fakeWorkloadStream{msgs: []int{1, 2}}
+	downstream := &erroringWorkloadStream{err: downstreamErr}
+
+	err := relayWorkloadStream[int](upstream, downstream)
+	if !errors.Is(err, downstreamErr) {
+		t.Fatalf("relayWorkloadStream error = %v, want %v", err, downstreamErr)
+	}
+}
+
+type erroringWorkloadStream struct {
+	err error
+}
+
+func (e *erroringWorkloadStream) Send(int) error {
+	return e.err
+}
@@ -0,0 +1,76 @@
+package endpoints
+
+import (
+	"errors"
+	"net"
+
+	proxyproto "github.com/pires/go-proxyproto"
+)
+
+// wrapProxyProtocol wraps l so that connections arriving from
+// ep.trustedProxies are expected to carry a PROXY protocol v1/v2 header.
+// The original client address the header encodes replaces the raw TCP
+// peer address seen by attestation and logging. Connections from
+// sources outside ep.trustedProxies are rejected before the handshake.
+// l is returned unwrapped if ep has no trusted proxies configured.
+func wrapProxyProtocol(l net.Listener, ep *endpoint) net.Listener {
+	if len(ep.trustedProxies) == 0 {
+		return l
+	}
+
+	return &rejectSurvivingListener{
+		Listener: &proxyproto.Listener{
+			Listener: l,
+			Policy:   proxyProtocolPolicy(ep),
+		},
+	}
+}
+
+// rejectSurvivingListener absorbs the per-connection error proxyproto.Listener
+// raises when its Policy rejects a source. proxyproto.Listener.Accept returns
+// proxyproto.ErrInvalidUpstream (a non-temporary error) in that case, and
+// grpc.Server.Serve treats any non-temporary Accept error as fatal, returning
+// immediately — which, through the errgroup in Endpoints.ListenAndServe,
+// would tear down every other listener and the gateway over a single
+// connection from an untrusted address. Accept retries past that one error
+// instead of letting it escape, so a rejected connection costs nothing but
+// itself.
+type rejectSurvivingListener struct {
+	net.Listener
+}
+
+func (l *rejectSurvivingListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err == nil {
+			return conn, nil
+		}
+		if errors.Is(err, proxyproto.ErrInvalidUpstream) {
+			continue
+		}
+		return nil, err
+	}
+}
+
+func proxyProtocolPolicy(ep *endpoint) proxyproto.PolicyFunc {
+	return func(upstream net.Addr) (proxyproto.Policy, error) {
+		host, _, err := net.SplitHostPort(upstream.String())
+		if err != nil {
+			return proxyproto.REJECT, proxyproto.ErrInvalidUpstream
+		}
+		ip := net.ParseIP(host)
+		for _, cidr := range ep.trustedProxies {
+			if cidr.Contains(ip) {
+				if ep.requireProxyHeader {
+					return proxyproto.REQUIRE, nil
+				}
+				return proxyproto.USE, nil
+			}
+		}
+		ep.log.WithField("source", upstream).Warn("Rejecting TCP connection from untrusted proxy source")
+		// A nil error with REJECT would only refuse connections that carry
+		// a PROXY header; ErrInvalidUpstream makes proxyproto.Listener close
+		// the connection before it is handed on.
+		return proxyproto.REJECT, proxyproto.ErrInvalidUpstream
+	}
+}
@@ -0,0 +1,175 @@
+package endpoints
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	proxyproto "github.com/pires/go-proxyproto"
+	"github.com/sirupsen/logrus"
+)
+
+func TestProxyProtocolPolicyRejectsUntrustedSource(t *testing.T) {
+	ep := &endpoint{
+		log:            logrus.New(),
+		trustedProxies: mustParseCIDRs(t, "10.0.0.0/8"),
+	}
+	policy := proxyProtocolPolicy(ep)
+
+	got, err := policy(&net.TCPAddr{IP: net.ParseIP("203.0.113.1"), Port: 12345})
+	if !errors.Is(err, proxyproto.ErrInvalidUpstream) {
+		t.Fatalf("source outside TrustedProxies: got error %v, want %v", err, proxyproto.ErrInvalidUpstream)
+	}
+	if got != proxyproto.REJECT {
+		t.Fatalf("source outside TrustedProxies: got policy %v, want REJECT", got)
+	}
+}
+
+func TestProxyProtocolPolicyUsesHeaderFromTrustedSource(t *testing.T) {
+	ep := &endpoint{
+		log:            logrus.New(),
+		trustedProxies: mustParseCIDRs(t, "10.0.0.0/8"),
+	}
+	policy := proxyProtocolPolicy(ep)
+
+	got, err := policy(&net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 12345})
+	if err != nil {
+		t.Fatalf("policy returned error: %v", err)
+	}
+	if got != proxyproto.USE {
+		t.Fatalf("source inside TrustedProxies: got policy %v, want USE", got)
+	}
+}
+
+func TestProxyProtocolPolicyRequiresHeaderWhenConfigured(t *testing.T) {
+	ep := &endpoint{
+		log:                logrus.New(),
+		trustedProxies:     mustParseCIDRs(t, "10.0.0.0/8"),
+		requireProxyHeader: true,
+	}
+	policy := proxyProtocolPolicy(ep)
+
+	got, err := policy(&net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 12345})
+	if err != nil {
+		t.Fatalf("policy returned error: %v", err)
+	}
+	if got != proxyproto.REQUIRE {
+		t.Fatalf("trusted source with RequireProxyHeader: got policy %v, want REQUIRE", got)
+	}
+}
+
+// TestWrapProxyProtocolAcceptSurvivesUntrustedSource drives a real Accept
+// loop, not just the policy function: a connection from an untrusted
+// source must not turn into a fatal Accept error that would propagate up
+// through grpc.Server.Serve and, via the errgroup in
+// Endpoints.ListenAndServe, take down every other listener.
+func TestWrapProxyProtocolAcceptSurvivesUntrustedSource(t *testing.T) {
+	rawListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer rawListener.Close()
+
+	ep := &endpoint{
+		log:            logrus.New(),
+		trustedProxies: mustParseCIDRs(t, "127.0.0.1/32"),
+	}
+	wrapped := wrapProxyProtocol(rawListener, ep)
+
+	acceptErr := make(chan error, 1)
+	acceptConn := make(chan net.Conn, 1)
+	go func() {
+		conn, err := wrapped.Accept()
+		if err != nil {
+			acceptErr <- err
+			return
+		}
+		acceptConn <- conn
+	}()
+
+	// 127.0.0.2 is still loopback on Linux but outside ep.trustedProxies,
+	// so the policy rejects it.
+	untrustedConn, err := (&net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP("127.0.0.2")}}).
+		Dial("tcp", rawListener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial untrusted source: %v", err)
+	}
+	defer untrustedConn.Close()
+
+	// If the rejection above had escaped Accept as a fatal error, the
+	// goroutine would already have returned and this dial's connection
+	// would never be picked up.
+	trustedConn, err := (&net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1")}}).
+		Dial("tcp", rawListener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial trusted source: %v", err)
+	}
+	defer trustedConn.Close()
+
+	select {
+	case err := <-acceptErr:
+		t.Fatalf("Accept returned a fatal error instead of surviving the untrusted connection: %v", err)
+	case conn := <-acceptConn:
+		conn.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for Accept to return the trusted connection")
+	}
+}
+
+func TestRejectSurvivingListenerPropagatesOtherErrors(t *testing.T) {
+	fatal := errors.New("listener closed")
+	l := &rejectSurvivingListener{Listener: &fakeAcceptListener{results: []acceptResult{{err: fatal}}}}
+
+	if _, err := l.Accept(); !errors.Is(err, fatal) {
+		t.Fatalf("Accept error = %v, want %v", err, fatal)
+	}
+}
+
+func TestRejectSurvivingListenerRetriesPastRejections(t *testing.T) {
+	good := &net.TCPConn{}
+	l := &rejectSurvivingListener{Listener: &fakeAcceptListener{results: []acceptResult{
+		{err: proxyproto.ErrInvalidUpstream},
+		{err: proxyproto.ErrInvalidUpstream},
+		{conn: good},
+	}}}
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	if conn != net.Conn(good) {
+		t.Fatalf("Accept returned %v, want the connection behind the rejected attempts", conn)
+	}
+}
+
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+// fakeAcceptListener replays a canned sequence of Accept results, letting
+// rejectSurvivingListener's retry logic be tested without real sockets.
+type fakeAcceptListener struct {
+	net.Listener
+	results []acceptResult
+}
+
+func (f *fakeAcceptListener) Accept() (net.Conn, error) {
+	r := f.results[0]
+	f.results = f.results[1:]
+	return r.conn, r.err
+}
+
+func mustParseCIDRs(t *testing.T, cidrs ...string) []*net.IPNet {
+	t.Helper()
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("parse CIDR %q: %v", cidr, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
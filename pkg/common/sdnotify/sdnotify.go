@@ -0,0 +1,123 @@
+// Package sdnotify implements a minimal client for the systemd sd_notify
+// protocol (readiness, reload, stopping, and watchdog keepalives). It is
+// a no-op whenever NOTIFY_SOCKET is unset, so callers can use it
+// unconditionally on hosts that are not managed by systemd.
+package sdnotify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Notifier sends state updates to the systemd service manager.
+type Notifier struct {
+	addr *net.UnixAddr
+}
+
+// New returns a Notifier configured from the NOTIFY_SOCKET environment
+// variable. If NOTIFY_SOCKET is unset, the returned Notifier silently
+// discards every notification.
+func New() *Notifier {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return &Notifier{}
+	}
+	return &Notifier{addr: &net.UnixAddr{Name: socket, Net: "unixgram"}}
+}
+
+// Enabled reports whether NOTIFY_SOCKET was set and notifications will
+// actually be delivered.
+func (n *Notifier) Enabled() bool {
+	return n.addr != nil
+}
+
+// Ready notifies systemd that the service has finished starting and is
+// ready to handle requests. status, if non-empty, is surfaced to
+// "systemctl status" as the service's status line.
+func (n *Notifier) Ready(status string) error {
+	state := "READY=1"
+	if status != "" {
+		state += "\nSTATUS=" + status
+	}
+	return n.notify(state)
+}
+
+// Reloading notifies systemd that the service is reloading its
+// configuration. Callers should send Ready once the reload completes.
+func (n *Notifier) Reloading() error {
+	return n.notify("RELOADING=1")
+}
+
+// Stopping notifies systemd that the service is beginning a graceful
+// shutdown.
+func (n *Notifier) Stopping() error {
+	return n.notify("STOPPING=1")
+}
+
+// WatchdogPing sends a single watchdog keepalive.
+func (n *Notifier) WatchdogPing() error {
+	return n.notify("WATCHDOG=1")
+}
+
+// WatchdogInterval returns the interval at which WatchdogPing must be
+// called to keep systemd from treating the service as hung, derived
+// from WATCHDOG_USEC. ok is false if no watchdog is configured.
+func WatchdogInterval() (interval time.Duration, ok bool) {
+	usec := os.Getenv("WATCHDOG_USEC")
+	if usec == "" {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Microsecond, true
+}
+
+// RunWatchdog starts a goroutine that calls WatchdogPing at half of
+// WATCHDOG_USEC for as long as probe returns nil, stopping when ctx is
+// canceled. It is a no-op if notifications are disabled or no watchdog
+// interval is configured. probe should perform an actual liveness check
+// rather than always succeeding, so a wedged process stops being pinged
+// and systemd can restart it.
+func (n *Notifier) RunWatchdog(ctx context.Context, probe func(ctx context.Context) error) {
+	interval, ok := WatchdogInterval()
+	if !n.Enabled() || !ok {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := probe(ctx); err != nil {
+					continue
+				}
+				_ = n.WatchdogPing()
+			}
+		}
+	}()
+}
+
+func (n *Notifier) notify(state string) error {
+	if n.addr == nil {
+		return nil
+	}
+	conn, err := net.DialUnix(n.addr.Net, nil, n.addr)
+	if err != nil {
+		return fmt.Errorf("sdnotify: dial %s: %w", n.addr, err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("sdnotify: write %s: %w", n.addr, err)
+	}
+	return nil
+}